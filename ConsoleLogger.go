@@ -2,24 +2,54 @@ package log
 
 import (
 	"fmt"
+	"sync/atomic"
 )
 
-var ConsoleLogger = &ConsoleLog{}
+var ConsoleLogger = newConsoleLog()
 
-type ConsoleLog struct{}
+type ConsoleLog struct {
+	level     int32
+	formatter atomic.Value // Formatter
+}
+
+// newConsoleLog returns a *ConsoleLog with the default, backwards
+// compatible level and Formatter.
+func newConsoleLog() *ConsoleLog {
+	nl := &ConsoleLog{level: int32(LevelDebug)}
+	nl.formatter.Store(Formatter(TextFormatter{}))
+
+	return nl
+}
 
 func (nl *ConsoleLog) Debug(format string, v ...interface{}) {
-	nl.Print(NewLogMsg("debug", format, 2, v...))
+	nl.Print(NewLogMsgWithLevel("debug", LevelDebug, format, 2, v...))
 }
 
 func (nl *ConsoleLog) Error(format string, v ...interface{}) {
-	nl.Print(NewLogMsg("error", format, 2, v...))
+	nl.Print(NewLogMsgWithLevel("error", LevelError, format, 2, v...))
 }
 
 func (nl *ConsoleLog) Info(format string, v ...interface{}) {
-	nl.Print(NewLogMsg("info", format, 2, v...))
+	nl.Print(NewLogMsgWithLevel("info", LevelInfo, format, 2, v...))
+}
+
+// SetLevel sets this instance's per-instance verbosity threshold.
+// Messages with a higher Level are dropped by Print.
+func (nl *ConsoleLog) SetLevel(l Level) {
+	atomic.StoreInt32(&nl.level, int32(l))
+}
+
+// SetFormatter sets the Formatter used to render every message this log
+// prints.
+func (nl *ConsoleLog) SetFormatter(f Formatter) {
+	nl.formatter.Store(f)
 }
 
 func (nl *ConsoleLog) Print(msg *LogMsg) {
-	fmt.Print(msg)
+	if msg.Level > Level(atomic.LoadInt32(&nl.level)) {
+		return
+	}
+
+	f := nl.formatter.Load().(Formatter)
+	fmt.Print(string(f.Format(msg)))
 }
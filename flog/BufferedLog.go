@@ -18,8 +18,6 @@ import (
 
 	"bytes"
 	"context"
-	"fmt"
-	"io"
 	"log"
 	"os"
 	"runtime/trace"
@@ -28,24 +26,38 @@ import (
 	"time"
 )
 
-const blMaxBufferSize = 64 * 1024 // 64KB
-
 // BufferedLog represents a buffered, file-backed logger and enforces a standardized
-// logging format. New logging entries are sent to a memory buffer and
-// periodically flushed to the backing file at configurable intervals
-// by a seperate goroutine.
+// logging format. New logging entries are sent onto an internal message queue,
+// with a full queue handled per the log's AsyncConfig.Overflow, and batched onto the backing file by a separate writer
+// goroutine, keeping Print off the hot path of any disk I/O.
 type BufferedLog struct {
-	baseDir   string
-	buffer    bytes.Buffer
-	shutdown  *shutdown.Sync
-	enabled   bool
-	file      *os.File
-	flushSec  int32
-	flushChan chan interface{}
-	hasClosed bool
-	lock      sync.RWMutex
-	logger    *log.Logger
-	name      string
+	asyncCfg      AsyncConfig
+	baseDir       string
+	byteCount     int64
+	dropped       int64
+	enabled       int32
+	file          *os.File
+	formatter     xlog.Formatter
+	hasClosed     int32
+	lastRotate    time.Time
+	level         int32
+	lineCount     int64
+	lock          sync.RWMutex
+	name          string
+	queue         chan *xlog.LogMsg
+	rotateCfg     RotateConfig
+	sampleCounter int64
+	sampler       atomic.Value // samplerBox
+	shutdown      *shutdown.Sync
+	sweepShutdown *shutdown.Sync
+}
+
+// samplerBox wraps an xlog.Sampler so it can be stored in an atomic.Value;
+// atomic.Value requires every Store to use the same concrete type, which a
+// bare interface value can't guarantee across different Sampler
+// implementations.
+type samplerBox struct {
+	sampler xlog.Sampler
 }
 
 // BaseDir returns the base directory of the file backing this BufferedLog instance.
@@ -58,55 +70,70 @@ func (this *BufferedLog) BaseDir() string {
 	return this.baseDir
 }
 
-// BufferCap returns the current capacity of the underlying memory buffer.
-func (this *BufferedLog) BufferCap() int {
-	ctx := context.Background()
-
-	trace.WithRegion(ctx, "BufferCap().acquireReadLock", this.lock.RLock)
-	defer this.lock.RUnlock()
+// Config returns the RotateConfig and AsyncConfig this BufferedLog was
+// constructed with. rotateCfg and asyncCfg are set once by New and never
+// mutated afterward, with one exception: asyncCfg.flushSec can change at
+// any time via SetFlushIntervalSec. Copying asyncCfg wholesale would race
+// with that atomic store, so its fields are copied out individually and
+// flushSec is substituted with an atomic load.
+func (this *BufferedLog) Config() Config {
+	async := AsyncConfig{
+		QueueDepth: this.asyncCfg.QueueDepth,
+		BatchSize:  this.asyncCfg.BatchSize,
+		Overflow:   this.asyncCfg.Overflow,
+		SampleN:    this.asyncCfg.SampleN,
+		flushSec:   atomic.LoadInt32(&this.asyncCfg.flushSec),
+	}
 
-	return this.buffer.Cap()
+	return Config{Rotate: this.rotateCfg, Async: async}
 }
 
-// Close disables the BufferedLog instance, flushes any remaining entries to disk, and
-// then closes the backing log file.
+// Close disables the BufferedLog instance, signals its writer goroutine to drain
+// and flush any remaining queued entries to disk, and then closes the backing
+// log file.
 func (this *BufferedLog) Close() {
-	if this.hasClosed {
+	if !atomic.CompareAndSwapInt32(&this.hasClosed, 0, 1) {
 		return
 	}
 
-	this.hasClosed = true
-
-	ctx := context.Background()
-	this.print(ctx, xlog.NewLogMsg(this.name, "==== Close log ====", 2))
+	this.enqueue(xlog.NewLogMsg(this.name, "==== Close log ====", 2))
 
-	// stop flush routine
+	// stop writer goroutine
 	this.shutdown.Start()
 
 	if this.shutdown.WaitForTimeout() {
-		this.print(ctx, xlog.NewLogMsg(this.name, "Timeout waiting on shutdown", 2))
+		this.enqueue(xlog.NewLogMsg(this.name, "Timeout waiting on shutdown", 2))
 	}
 
-	// flush logs
-	this.flushLogs()
-
 	// close file
 	this.file.Close()
+
+	// stop retention sweeper
+	if this.sweepShutdown != nil {
+		this.sweepShutdown.Start()
+	}
 }
 
 // SetEnabled temporarily enables/disables the log instance.
 func (this *BufferedLog) SetEnabled(enabled bool) {
-	ctx := context.Background()
-
-	trace.WithRegion(ctx, "SetEnabled().acquireLock", this.lock.Lock)
-	defer this.lock.Unlock()
+	v := int32(0)
+	if enabled {
+		v = 1
+	}
 
-	this.enabled = enabled
+	atomic.StoreInt32(&this.enabled, v)
 }
 
-// FlushInterval returns the interval between log flushes in seconds.
+// FlushIntervalSec returns the interval, in seconds, at which the writer goroutine
+// flushes a partial batch to disk even if it hasn't filled up.
 func (this *BufferedLog) FlushIntervalSec() int32 {
-	return atomic.LoadInt32(&this.flushSec)
+	return atomic.LoadInt32(&this.asyncCfg.flushSec)
+}
+
+// SetFlushIntervalSec sets the interval at which the writer goroutine will
+// flush a partial batch of queued entries into the backing log file.
+func (this *BufferedLog) SetFlushIntervalSec(interval int32) {
+	atomic.StoreInt32(&this.asyncCfg.flushSec, interval)
 }
 
 // Name returns the friendly name of the log.
@@ -119,104 +146,265 @@ func (this *BufferedLog) Name() string {
 	return this.name
 }
 
-// Print formats and buffers a new log entry as long as the BufferedLog instance
-// is enabled.
+// SetSampler attaches a Sampler that Print consults before queuing each
+// message, letting a single noisy call site be throttled or
+// duplicate-suppressed without affecting the rest of the log. A nil
+// Sampler, the default, allows every message through.
+func (this *BufferedLog) SetSampler(s xlog.Sampler) {
+	this.sampler.Store(samplerBox{s})
+}
+
+// getSampler returns the log's currently attached Sampler, or nil if none
+// has been set.
+func (this *BufferedLog) getSampler() xlog.Sampler {
+	v := this.sampler.Load()
+	if v == nil {
+		return nil
+	}
+
+	return v.(samplerBox).sampler
+}
+
+// Print queues a new log entry for the writer goroutine as long as the
+// BufferedLog instance is enabled, msg.Level doesn't exceed the log's
+// configured verbosity threshold (see SetLevel), and the log's Sampler, if
+// any, allows it (see SetSampler). Print never blocks on disk I/O;
+// depending on the log's AsyncConfig, it may briefly block on queue space,
+// or drop the message, if the writer goroutine has fallen behind.
 func (this *BufferedLog) Print(msg *xlog.LogMsg) {
-	ctx := context.Background()
+	if msg.Level > this.Level() {
+		return
+	}
+
+	if atomic.LoadInt32(&this.enabled) == 0 {
+		return
+	}
 
-	trace.WithRegion(ctx, "Print().acquireReadLock", this.lock.RLock)
-	if !this.enabled {
-		this.lock.RUnlock()
+	if atomic.LoadInt32(&this.hasClosed) != 0 {
+		// The writer goroutine is gone or going; nothing will ever drain
+		// this.queue again, so sending here - especially under the
+		// default Block policy - could wait forever. Drop instead.
+		atomic.AddInt64(&this.dropped, 1)
 		return
 	}
-	this.lock.RUnlock()
 
-	this.print(ctx, msg)
+	if sampler := this.getSampler(); sampler != nil {
+		ok, summary := sampler.Allow(msg)
+		if summary != nil {
+			this.enqueue(summary)
+		}
+		if !ok {
+			return
+		}
+	}
+
+	this.enqueue(msg)
 }
 
-// SetFlushIntervalSec sets the interval at which the log buffer worker
-// will attempt to flush new entries into the backing log file.
-func (this *BufferedLog) SetFlushIntervalSec(interval int32) {
-	atomic.StoreInt32(&this.flushSec, interval)
+// Level returns the log's current per-instance verbosity threshold.
+func (this *BufferedLog) Level() xlog.Level {
+	return xlog.Level(atomic.LoadInt32(&this.level))
+}
+
+// SetLevel sets the log's per-instance verbosity threshold. Messages
+// with a higher Level are dropped by Print.
+func (this *BufferedLog) SetLevel(l xlog.Level) {
+	atomic.StoreInt32(&this.level, int32(l))
 }
 
-// asyncFlush is run in a separate goroutine and periodically flushes
-// buffered entries to the backing file.
-func (this *BufferedLog) asyncFlush() {
+// SetFormatter sets the Formatter used to render every message this log
+// writes, both to its backing file and to the stdlib log mirror.
+func (this *BufferedLog) SetFormatter(f xlog.Formatter) {
+	ctx := context.Background()
+
+	trace.WithRegion(ctx, "SetFormatter().acquireLock", this.lock.Lock)
+	defer this.lock.Unlock()
+
+	this.formatter = f
+}
+
+// Dropped returns the number of messages this log has discarded because its
+// queue was full under a DropOldest, DropNewest, or SampleEveryN
+// OverflowPolicy, or because Print was called after Close. Under the
+// default Block policy it counts only the latter.
+func (this *BufferedLog) Dropped() int64 {
+	return atomic.LoadInt64(&this.dropped)
+}
+
+// QueueLen returns the number of messages currently queued, waiting on the
+// writer goroutine.
+func (this *BufferedLog) QueueLen() int {
+	return len(this.queue)
+}
+
+// QueueCap returns the capacity of the log's message queue.
+func (this *BufferedLog) QueueCap() int {
+	return cap(this.queue)
+}
+
+// enqueue hands msg to the writer goroutine via this.queue, applying the
+// log's configured OverflowPolicy if the queue is currently full.
+func (this *BufferedLog) enqueue(msg *xlog.LogMsg) {
+	switch this.asyncCfg.Overflow {
+	case DropNewest:
+		select {
+		case this.queue <- msg:
+		default:
+			atomic.AddInt64(&this.dropped, 1)
+		}
+
+	case DropOldest:
+		select {
+		case this.queue <- msg:
+		default:
+			select {
+			case <-this.queue:
+				atomic.AddInt64(&this.dropped, 1)
+			default:
+			}
+
+			select {
+			case this.queue <- msg:
+			default:
+				atomic.AddInt64(&this.dropped, 1)
+			}
+		}
+
+	case SampleEveryN:
+		select {
+		case this.queue <- msg:
+		default:
+			sampleN := int64(this.asyncCfg.SampleN)
+			if sampleN < 1 {
+				sampleN = 1
+			}
+
+			n := atomic.AddInt64(&this.sampleCounter, 1)
+			if (n-1)%sampleN != 0 {
+				atomic.AddInt64(&this.dropped, 1)
+				return
+			}
+
+			select {
+			case this.queue <- msg:
+			default:
+				atomic.AddInt64(&this.dropped, 1)
+			}
+		}
+
+	default: // Block
+		this.queue <- msg
+	}
+}
+
+// writeLoop is run in a separate goroutine. It batches queued messages, up to
+// the log's configured BatchSize, into a single write+Sync against the
+// backing file, flushing a partial batch after FlushIntervalSec elapses so
+// low-volume logs still reach disk promptly.
+func (this *BufferedLog) writeLoop() {
 	defer this.shutdown.Complete()
 
 	ctx := context.Background()
+	batch := make([]*xlog.LogMsg, 0, this.asyncCfg.BatchSize)
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		trace.WithRegion(ctx, "writeLoop().writeBatch", func() {
+			this.writeBatch(batch)
+		})
+		batch = batch[:0]
+	}
 
 	for {
-		flushSec := atomic.LoadInt32(&this.flushSec)
+		flushSec := atomic.LoadInt32(&this.asyncCfg.flushSec)
 
 		select {
 		case <-this.shutdown.Signal:
-			this.print(ctx, xlog.NewLogMsg(
-				this.name,
-				"Async log shutdown",
-				3,
-			))
+			flush()
+			this.drainRemaining()
 			return
-		case <-this.flushChan:
-			trace.Log(ctx, "flushChan triggered", "")
-			trace.WithRegion(ctx, "flushLogs()", this.flushLogs)
+		case msg := <-this.queue:
+			batch = append(batch, msg)
+			if len(batch) >= this.asyncCfg.BatchSize {
+				flush()
+			}
 		case <-time.After(time.Duration(flushSec) * time.Second):
-			trace.Log(ctx, "flushSecElapsed", fmt.Sprintf("%d", flushSec))
-			this.flushLogs()
+			flush()
 		}
 	}
 }
 
-// flushLogs copies the contents of the log buffer into the open log file.
-func (this *BufferedLog) flushLogs() {
-	ctx := context.Background()
+// drainRemaining flushes whatever is left on the queue at shutdown in the
+// same BatchSize-sized chunks writeLoop would use during normal
+// operation, rather than one unbounded batch, so rotation is still
+// evaluated at its configured cadence instead of being collapsed into a
+// single oversized, at-most-once check.
+func (this *BufferedLog) drainRemaining() {
+	batch := make([]*xlog.LogMsg, 0, this.asyncCfg.BatchSize)
 
-	trace.WithRegion(ctx, "flushLogs().acquireLock", this.lock.Lock)
+	for {
+		select {
+		case msg := <-this.queue:
+			batch = append(batch, msg)
+			if len(batch) >= this.asyncCfg.BatchSize {
+				this.writeBatch(batch)
+				batch = batch[:0]
+			}
+		default:
+			if len(batch) > 0 {
+				this.writeBatch(batch)
+			}
+			return
+		}
+	}
+}
+
+// writeBatch formats and writes a batch of queued messages to the backing
+// file in a single call, then checks whether rotation is due.
+func (this *BufferedLog) writeBatch(batch []*xlog.LogMsg) {
+	this.lock.Lock()
 	defer this.lock.Unlock()
 
-	// flush may have just happened, so check
-	// the buffer len again before blocking on the
-	// disk
-	if this.buffer.Len() < blMaxBufferSize {
-		return
+	var buf bytes.Buffer
+
+	for _, msg := range batch {
+		formatted := string(this.formatter.Format(msg))
+		log.Print(formatted)
+		buf.WriteString(formatted)
+
+		atomic.AddInt64(&this.byteCount, int64(len(formatted)))
+		atomic.AddInt64(&this.lineCount, 1)
 	}
 
-	r := trace.StartRegion(ctx, "flushLogs().write")
-	_, err := io.Copy(this.file, &this.buffer)
-	r.End()
-	if err != nil {
-		panic(err)
+	this.file.Write(buf.Bytes())
+	this.file.Sync()
+
+	needsRotate := shouldRotate(
+		this.rotateCfg,
+		atomic.LoadInt64(&this.byteCount),
+		atomic.LoadInt64(&this.lineCount),
+		this.lastRotate,
+		time.Now(),
+	)
+	if needsRotate {
+		this.doRotate()
 	}
+}
 
-	r = trace.StartRegion(ctx, "flushLogs().sync")
-	err = this.file.Sync()
-	r.End()
+// doRotate closes the current backing file, moves it into the configured
+// old/ directory, and opens a fresh file in its place. It is only ever
+// called by writeBatch, with this.lock already held.
+func (this *BufferedLog) doRotate() {
+	newFile, err := rotateToOld(this.file, this.baseDir, this.name, this.rotateCfg)
 	if err != nil {
 		panic(err)
 	}
-}
-
-func (this *BufferedLog) print(ctx context.Context, msg *xlog.LogMsg) {
-	trace.WithRegion(ctx, "print().acquireLock", this.lock.Lock)
-
-	r := trace.StartRegion(ctx, "print().delegates")
-	log.Print(msg)
-	this.logger.Print(msg)
-	r.End()
-
-	if this.buffer.Len() > blMaxBufferSize {
-		this.lock.Unlock()
 
-		r = trace.StartRegion(ctx, "print().requestFlush")
-		select {
-		case this.flushChan <- nil:
-			return
-		case <-time.After(1 * time.Second):
-			return
-		}
-		r.End()
-	} else {
-		this.lock.Unlock()
-	}
+	this.file = newFile
+	atomic.StoreInt64(&this.byteCount, 0)
+	atomic.StoreInt64(&this.lineCount, 0)
+	this.lastRotate = time.Now()
 }
@@ -2,7 +2,7 @@
 //
 //  DirectLog.go
 //
-//  Copyright (c) 2014, Jared Chavez. 
+//  Copyright (c) 2014, Jared Chavez.
 //  All rights reserved.
 //
 //  Use of this source code is governed by a BSD-style
@@ -13,84 +13,201 @@
 package flog
 
 import (
-    "fmt"
-    "log"
-    "os"
-    "strings"
-    "sync"
-    "sync/atomic"
+	xlog "github.com/xaevman/log"
+	"github.com/xaevman/shutdown"
+
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // DirectLog represents a file-backed logger and enforces a standardized
-// logging format. New logging entries are written immediately to the 
+// logging format. New logging entries are written immediately to the
 // backing file.
 type DirectLog struct {
-    baseDir  string
-    enabled  int32
-    file     *os.File
-    lock     sync.RWMutex
-    logger   *log.Logger
-    name     string
+	baseDir       string
+	enabled       int32
+	file          *os.File
+	formatter     xlog.Formatter
+	lastRotateNs  int64
+	level         int32
+	lineCount     int64
+	byteCount     int64
+	lock          sync.RWMutex
+	logger        *log.Logger
+	name          string
+	rotateCfg     RotateConfig
+	sampler       xlog.Sampler
+	sweepShutdown *shutdown.Sync
 }
 
 // BaseDir returns the base directory of the file backing this DirectLog instance.
 func (this *DirectLog) BaseDir() string {
-    this.lock.RLock()
-    defer this.lock.RUnlock()
+	this.lock.RLock()
+	defer this.lock.RUnlock()
 
-    return this.baseDir
+	return this.baseDir
+}
+
+// Config returns the RotateConfig this DirectLog was constructed with,
+// wrapped in a Config with a zero-valued Async (DirectLog writes
+// synchronously, so async tuning doesn't apply). rotateCfg is set once
+// by New and never mutated afterward, so no locking is required to read
+// it.
+func (this *DirectLog) Config() Config {
+	return Config{Rotate: this.rotateCfg}
 }
 
 // Close disables the DirectLog instance, flushes any remaining entries to disk, and
 // then closes the backing log file.
 func (this *DirectLog) Close() {
-    this.lock.Lock()
-    defer this.lock.Unlock()
+	this.lock.Lock()
+	defer this.lock.Unlock()
 
-    this.enabled = 0
+	atomic.StoreInt32(&this.enabled, 0)
 
-    this.print(fmt.Sprintf(
-        "==== Close log [%s] ====",
-        strings.ToUpper(this.name),
-    ))
+	closeMsg := string(this.formatter.Format(xlog.NewLogMsg(this.name, "==== Close log ====", 2)))
+	log.Print(closeMsg)
+	this.logger.Print(closeMsg)
 
-    this.file.Sync()
-    this.file.Close()
+	if this.sweepShutdown != nil {
+		this.sweepShutdown.Start()
+	}
+
+	this.file.Sync()
+	this.file.Close()
 }
 
 // Disable temporarily disables the DirectLog instance. New calls to Print will have no
 // effect.
 func (this *DirectLog) Disable() {
-    atomic.StoreInt32(&this.enabled, 0)
+	atomic.StoreInt32(&this.enabled, 0)
 }
 
 // Enable re-enables an DirectLog instance.
 func (this *DirectLog) Enable() {
-    atomic.StoreInt32(&this.enabled, 1)
+	atomic.StoreInt32(&this.enabled, 1)
+}
+
+// SetEnabled temporarily enables/disables the log instance.
+func (this *DirectLog) SetEnabled(enabled bool) {
+	if enabled {
+		this.Enable()
+		return
+	}
+
+	this.Disable()
 }
 
-// Name returns the friendly name of the log. 
+// Name returns the friendly name of the log.
 func (this *DirectLog) Name() string {
-    this.lock.RLock()
-    defer this.lock.RUnlock()
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	return this.name
+}
 
-    return this.name
+// Level returns the log's current per-instance verbosity threshold.
+func (this *DirectLog) Level() xlog.Level {
+	return xlog.Level(atomic.LoadInt32(&this.level))
 }
 
-// Print formats and buffers a new log entry as long as the DirectLog instance
-// is enabled.
-func (this *DirectLog) Print(msg string) {
-    this.lock.RLock()
-    defer this.lock.RUnlock()
+// SetLevel sets the log's per-instance verbosity threshold. Messages
+// with a higher Level are dropped by Print.
+func (this *DirectLog) SetLevel(l xlog.Level) {
+	atomic.StoreInt32(&this.level, int32(l))
+}
+
+// SetFormatter sets the Formatter used to render every message this log
+// writes, both to its backing file and to the stdlib log mirror.
+func (this *DirectLog) SetFormatter(f xlog.Formatter) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.formatter = f
+}
 
-    if atomic.LoadInt32(&this.enabled) < 1 {
-        return
-    }
+// SetSampler attaches a Sampler that Print consults before writing each
+// message, letting a single noisy call site be throttled or
+// duplicate-suppressed without affecting the rest of the log. A nil
+// Sampler, the default, allows every message through.
+func (this *DirectLog) SetSampler(s xlog.Sampler) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.sampler = s
+}
+
+// Print formats and immediately writes a new log entry as long as the
+// DirectLog instance is enabled, msg.Level doesn't exceed the log's
+// configured verbosity threshold (see SetLevel), and the log's Sampler,
+// if any, allows it (see SetSampler).
+func (this *DirectLog) Print(msg *xlog.LogMsg) {
+	if msg.Level > this.Level() {
+		return
+	}
+
+	this.lock.RLock()
+	enabled := atomic.LoadInt32(&this.enabled) > 0
+	sampler := this.sampler
+	this.lock.RUnlock()
+
+	if !enabled {
+		return
+	}
+
+	if sampler != nil {
+		ok, summary := sampler.Allow(msg)
+		if summary != nil {
+			this.write(summary)
+		}
+		if !ok {
+			return
+		}
+	}
+
+	this.write(msg)
+}
 
-    this.print(msg)
+// write formats and immediately writes msg to the backing file and the
+// stdlib log mirror, then updates rotation counters and rotates if
+// needed. The whole thing happens under a single exclusive lock
+// acquisition so that concurrent callers can't each independently
+// observe "rotation due" and race each other into rotate(); only the
+// caller that actually crosses the threshold under the lock rotates.
+func (this *DirectLog) write(msg *xlog.LogMsg) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	formatted := string(this.formatter.Format(msg))
+	log.Print(formatted)
+	this.logger.Print(formatted)
+
+	byteCount := atomic.AddInt64(&this.byteCount, int64(len(formatted)))
+	lineCount := atomic.AddInt64(&this.lineCount, 1)
+
+	last := time.Unix(0, atomic.LoadInt64(&this.lastRotateNs))
+	if shouldRotate(this.rotateCfg, byteCount, lineCount, last, time.Now()) {
+		this.rotate()
+	}
 }
 
-func (this *DirectLog) print(msg string) {
-    log.Print(msg)
-    this.logger.Print(msg)
+// rotate closes the current backing file, moves it into the configured
+// old/ directory, and opens a fresh file in its place. DirectLog writes
+// synchronously, so rotation happens inline on the Print call that
+// triggers it rather than on a separate worker. The caller must already
+// hold this.lock for writing.
+func (this *DirectLog) rotate() {
+	newFile, err := rotateToOld(this.file, this.baseDir, this.name, this.rotateCfg)
+	if err != nil {
+		panic(err)
+	}
+
+	this.file = newFile
+	this.logger = log.New(this.file, "", 0)
+	atomic.StoreInt64(&this.byteCount, 0)
+	atomic.StoreInt64(&this.lineCount, 0)
+	atomic.StoreInt64(&this.lastRotateNs, time.Now().UnixNano())
 }
@@ -75,3 +75,38 @@ func TestLog(t *testing.T) {
 
 
 }
+
+// TestAutoRotate configures a DirectLog with a line-count rotation policy
+// and verifies that it rotates itself into old/ without a manual call to
+// Rotate once the configured line count is exceeded. New's own "Log init"
+// banner counts as the first line, so with MaxLines: 2 the sequence is:
+// init (1), line 1 (2, rotates), line 2 (1), line 3 (2, rotates again) -
+// two rotations in all, each into its own distinct file.
+func TestAutoRotate(t *testing.T) {
+    if err := os.RemoveAll("./autologs"); err != nil {
+        t.Error(err)
+    }
+
+    dLog := New("auto", "./autologs", DirectFile, Config{
+        Rotate: RotateConfig{MaxLines: 2},
+    })
+
+    dLog.Print(log.NewLogMsg("auto", "line 1", 2))
+    dLog.Print(log.NewLogMsg("auto", "line 2", 2))
+    dLog.Print(log.NewLogMsg("auto", "line 3", 2))
+
+    dLog.Close()
+
+    oldLogs, err := filepath.Glob("./autologs/old/*-auto.log")
+    if err != nil {
+        t.Error(err)
+    }
+    if len(oldLogs) != 2 {
+        t.Error(fmt.Errorf("expected 2 rotated auto.log files, found %d", len(oldLogs)))
+    }
+
+    _, err = os.Stat("autologs/auto.log")
+    if err != nil {
+        t.Error(err)
+    }
+}
@@ -0,0 +1,104 @@
+//  ---------------------------------------------------------------------------
+//
+//  async.go
+//
+//  Copyright (c) 2014, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package flog
+
+// Default values used to fill in a zero-valued AsyncConfig.
+const (
+	DefaultQueueDepth = 1024
+	DefaultBatchSize  = 64
+)
+
+// OverflowPolicy controls what a BufferedLog does with a Print call that
+// arrives while its message queue is full.
+type OverflowPolicy int
+
+const (
+	// Block makes Print wait for room in the queue. This is the
+	// default, and never drops a message while the log is open,
+	// matching the original buffer+mutex implementation's behavior.
+	Block OverflowPolicy = iota
+
+	// DropOldest evicts the oldest queued message to make room for the
+	// new one.
+	DropOldest
+
+	// DropNewest discards the incoming message rather than waiting for
+	// room.
+	DropNewest
+
+	// SampleEveryN keeps only the 1st, and then every Nth, message that
+	// would otherwise overflow the queue; the rest are dropped.
+	SampleEveryN
+)
+
+// AsyncConfig controls a BufferedLog's write pipeline: how deep its
+// message queue is, how many messages its writer goroutine batches into
+// a single file write, and how a full queue is handled.
+type AsyncConfig struct {
+	// QueueDepth is the capacity of the log's message queue. Defaults
+	// to DefaultQueueDepth.
+	QueueDepth int
+
+	// BatchSize is the maximum number of messages the writer goroutine
+	// accumulates before issuing a single write+Sync to the backing
+	// file. Defaults to DefaultBatchSize.
+	BatchSize int
+
+	// Overflow selects how Print behaves when the queue is full.
+	// Defaults to Block.
+	Overflow OverflowPolicy
+
+	// SampleN is the sampling interval used when Overflow is
+	// SampleEveryN. Values <= 1 keep every message.
+	SampleN int
+
+	// flushSec is the interval, in seconds, at which a BufferedLog's
+	// writer goroutine flushes a partial batch to disk even if it
+	// hasn't filled up. It's read/written atomically via
+	// BufferedLog.FlushIntervalSec/SetFlushIntervalSec, so it lives
+	// here rather than as an exported, copy-by-value config knob.
+	flushSec int32
+}
+
+// DefaultAsyncConfig returns an AsyncConfig with the package's default
+// queue depth, batch size, and a Block overflow policy.
+func DefaultAsyncConfig() AsyncConfig {
+	return AsyncConfig{
+		QueueDepth: DefaultQueueDepth,
+		BatchSize:  DefaultBatchSize,
+		Overflow:   Block,
+		flushSec:   DefaultFlushIntervalSec,
+	}
+}
+
+// normalizeAsyncConfig returns the supplied AsyncConfig, if any, with its
+// zero-valued fields filled in from the defaults. With no argument it
+// returns DefaultAsyncConfig() unchanged.
+func normalizeAsyncConfig(cfg ...AsyncConfig) AsyncConfig {
+	c := DefaultAsyncConfig()
+
+	if len(cfg) > 0 {
+		if cfg[0].QueueDepth > 0 {
+			c.QueueDepth = cfg[0].QueueDepth
+		}
+		if cfg[0].BatchSize > 0 {
+			c.BatchSize = cfg[0].BatchSize
+		}
+		c.Overflow = cfg[0].Overflow
+		if cfg[0].SampleN > 0 {
+			c.SampleN = cfg[0].SampleN
+		}
+	}
+
+	return c
+}
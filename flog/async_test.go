@@ -0,0 +1,192 @@
+//  ---------------------------------------------------------------------------
+//
+//  async_test.go
+//
+//  Copyright (c) 2014, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package flog
+
+import (
+    "bytes"
+    "io"
+    "os"
+    "sort"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    "github.com/xaevman/log"
+)
+
+// TestOverflowPolicies fills a BufferedLog's queue under the DropNewest
+// OverflowPolicy and verifies that messages are dropped and counted.
+func TestOverflowPolicies(t *testing.T) {
+    if err := os.RemoveAll("./overflowlogs"); err != nil {
+        t.Error(err)
+    }
+
+    bLog := New("overflow", "./overflowlogs", BufferedFile, Config{
+        Async: AsyncConfig{
+            QueueDepth: 1,
+            BatchSize:  1,
+            Overflow:   DropNewest,
+        },
+    }).(*BufferedLog)
+
+    // block the writer goroutine so the queue stays full
+    bLog.lock.Lock()
+
+    for i := 0; i < 10; i++ {
+        bLog.Print(log.NewLogMsg("overflow", "msg", 2))
+    }
+
+    bLog.lock.Unlock()
+    bLog.Close()
+
+    if bLog.Dropped() == 0 {
+        t.Error("expected DropNewest to drop at least one message under sustained load")
+    }
+}
+
+// TestQueueAccessors verifies QueueCap reflects the configured
+// AsyncConfig.QueueDepth.
+func TestQueueAccessors(t *testing.T) {
+    if err := os.RemoveAll("./queuelogs"); err != nil {
+        t.Error(err)
+    }
+
+    bLog := New("queue", "./queuelogs", BufferedFile, Config{
+        Async: AsyncConfig{QueueDepth: 8, BatchSize: 8},
+    }).(*BufferedLog)
+    defer bLog.Close()
+
+    if bLog.QueueCap() != 8 {
+        t.Errorf("expected QueueCap() == 8, got %d", bLog.QueueCap())
+    }
+}
+
+// BenchmarkBufferedLogPrint measures BufferedLog.Print throughput and tail
+// latency under concurrent, contended calls from many goroutines.
+func BenchmarkBufferedLogPrint(b *testing.B) {
+    os.RemoveAll("./benchlogs")
+
+    bLog := New("bench", "./benchlogs", BufferedFile, Config{
+        Async: AsyncConfig{QueueDepth: 4096, BatchSize: 256},
+    }).(*BufferedLog)
+    defer bLog.Close()
+
+    var count int64
+    latencies := make([]time.Duration, b.N)
+
+    b.ResetTimer()
+
+    b.RunParallel(func(pb *testing.PB) {
+        for pb.Next() {
+            i := atomic.AddInt64(&count, 1) - 1
+
+            start := time.Now()
+            bLog.Print(log.NewLogMsg("bench", "benchmark message", 2))
+            latencies[i] = time.Since(start)
+        }
+    })
+
+    b.StopTimer()
+
+    sort.Slice(latencies, func(i, j int) bool {
+        return latencies[i] < latencies[j]
+    })
+
+    if len(latencies) > 0 {
+        idx := int(float64(len(latencies))*0.99) - 1
+        if idx < 0 {
+            idx = 0
+        }
+        b.ReportMetric(float64(latencies[idx].Nanoseconds()), "p99-ns/op")
+    }
+
+    b.ReportMetric(float64(bLog.Dropped()), "dropped")
+}
+
+// blMutexBufferSinkFlushThreshold mirrors the 64KB buffer size
+// BufferedLog flushed at before chunk0-4 replaced the buffer+mutex
+// implementation with the channel-based pipeline.
+const blMutexBufferSinkFlushThreshold = 64 * 1024
+
+// blMutexBufferSink is a minimal reproduction of BufferedLog's pre-chunk0-4
+// Print path - a formatted entry appended directly to a mutex-guarded
+// bytes.Buffer, flushed to disk once the buffer crosses a size threshold -
+// kept only so BenchmarkBufferedLogPrintMutexBaseline has something to
+// compare BenchmarkBufferedLogPrint's throughput/p99 against.
+type blMutexBufferSink struct {
+    lock      sync.Mutex
+    buffer    bytes.Buffer
+    file      *os.File
+    formatter log.Formatter
+}
+
+func (s *blMutexBufferSink) Print(msg *log.LogMsg) {
+    s.lock.Lock()
+    defer s.lock.Unlock()
+
+    s.buffer.WriteString(string(s.formatter.Format(msg)))
+
+    if s.buffer.Len() >= blMutexBufferSinkFlushThreshold {
+        io.Copy(s.file, &s.buffer)
+        s.file.Sync()
+    }
+}
+
+// BenchmarkBufferedLogPrintMutexBaseline measures the throughput/p99
+// latency of the mutex+buffer Print path BufferedLog used before
+// chunk0-4 switched it to the channel-based pipeline measured by
+// BenchmarkBufferedLogPrint, so benchstat can compare the two.
+func BenchmarkBufferedLogPrintMutexBaseline(b *testing.B) {
+    os.RemoveAll("./benchbaselinelogs")
+    if err := os.MkdirAll("./benchbaselinelogs", 0770); err != nil {
+        b.Fatal(err)
+    }
+
+    f, err := os.OpenFile("./benchbaselinelogs/bench.log", FLogOpenFlags, 0660)
+    if err != nil {
+        b.Fatal(err)
+    }
+    defer f.Close()
+
+    sink := &blMutexBufferSink{file: f, formatter: log.TextFormatter{}}
+
+    var count int64
+    latencies := make([]time.Duration, b.N)
+
+    b.ResetTimer()
+
+    b.RunParallel(func(pb *testing.PB) {
+        for pb.Next() {
+            i := atomic.AddInt64(&count, 1) - 1
+
+            start := time.Now()
+            sink.Print(log.NewLogMsg("bench", "benchmark message", 2))
+            latencies[i] = time.Since(start)
+        }
+    })
+
+    b.StopTimer()
+
+    sort.Slice(latencies, func(i, j int) bool {
+        return latencies[i] < latencies[j]
+    })
+
+    if len(latencies) > 0 {
+        idx := int(float64(len(latencies))*0.99) - 1
+        if idx < 0 {
+            idx = 0
+        }
+        b.ReportMetric(float64(latencies[idx].Nanoseconds()), "p99-ns/op")
+    }
+}
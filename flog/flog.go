@@ -19,7 +19,6 @@ import (
 	xlog "github.com/xaevman/log"
 	"github.com/xaevman/shutdown"
 
-	"fmt"
 	"log"
 	"os"
 	"path"
@@ -43,16 +42,48 @@ const (
 type FLog interface {
 	BaseDir() string
 	Close()
+	Config() Config
 	SetEnabled(bool)
 	Name() string
 	Print(msg *xlog.LogMsg)
 }
 
+// Config bundles the optional, New()-time knobs accepted by New: an
+// automatic rotation policy (Rotate) and, for BufferedLog, its async
+// write pipeline tuning (Async).
+type Config struct {
+	Rotate RotateConfig
+	Async  AsyncConfig
+}
+
+// normalizeConfig returns the supplied Config, if any, with its Rotate
+// and Async fields individually defaulted. With no argument it returns
+// the all-defaults Config, i.e. no automatic rotation and a Block-policy
+// async pipeline at the package's default depth/batch size.
+func normalizeConfig(cfg ...Config) Config {
+	if len(cfg) > 0 {
+		return Config{
+			Rotate: normalizeRotateConfig(cfg[0].Rotate),
+			Async:  normalizeAsyncConfig(cfg[0].Async),
+		}
+	}
+
+	return Config{
+		Rotate: normalizeRotateConfig(),
+		Async:  normalizeAsyncConfig(),
+	}
+}
+
 // New returns a new FLog instance of the requested type. The backing log file is
-// created or opened for append.
-func New(name, logPath string, logType int) FLog {
+// created or opened for append. An optional Config enables automatic rotation
+// by size, line count, and/or time interval plus retention sweeping of the
+// old/ directory, and, for BufferedLog, tunes the async write pipeline's queue
+// depth, batch size, and overflow policy; omitting it preserves the defaults.
+func New(name, logPath string, logType int, cfg ...Config) FLog {
 	var newLog FLog
 
+	c := normalizeConfig(cfg...)
+
 	mkdir(logPath)
 
 	f, err := os.OpenFile(
@@ -68,33 +99,42 @@ func New(name, logPath string, logType int) FLog {
 	case BufferedFile:
 
 		bLog := BufferedLog{
-			baseDir:   logPath,
-			shutdown:  shutdown.New(),
-			enabled:   true,
-			flushSec:  DefaultFlushIntervalSec,
-			flushChan: make(chan interface{}, 0),
-			name:      name,
+			baseDir:       logPath,
+			shutdown:      shutdown.New(),
+			sweepShutdown: shutdown.New(),
+			enabled:       1,
+			formatter:     xlog.TextFormatter{},
+			queue:         make(chan *xlog.LogMsg, c.Async.QueueDepth),
+			asyncCfg:      c.Async,
+			rotateCfg:     c.Rotate,
+			lastRotate:    time.Now(),
+			level:         int32(xlog.LevelDebug),
+			name:          name,
 		}
 
 		bLog.file = f
 
-		l := log.New(&bLog.buffer, "", 0)
-		bLog.logger = l
-
 		go func() {
 			defer crash.HandleAll()
-			bLog.asyncFlush()
+			bLog.writeLoop()
 		}()
 
+		startRetentionSweeper(bLog.sweepShutdown, logPath, name, c.Rotate)
+
 		newLog = &bLog
 		break
 
 	case DirectFile:
 
 		dLog := DirectLog{
-			baseDir: logPath,
-			enabled: true,
-			name:    name,
+			baseDir:       logPath,
+			sweepShutdown: shutdown.New(),
+			enabled:       1,
+			formatter:     xlog.TextFormatter{},
+			rotateCfg:     c.Rotate,
+			lastRotateNs:  time.Now().UnixNano(),
+			level:         int32(xlog.LevelDebug),
+			name:          name,
 		}
 
 		dLog.file = f
@@ -102,6 +142,8 @@ func New(name, logPath string, logType int) FLog {
 		l := log.New(dLog.file, "", 0)
 		dLog.logger = l
 
+		startRetentionSweeper(dLog.sweepShutdown, logPath, name, c.Rotate)
+
 		newLog = &dLog
 		break
 	}
@@ -118,37 +160,25 @@ func New(name, logPath string, logType int) FLog {
 }
 
 // Rotate takes a given FLog instance, closes it, timestamps and moves the
-// backing log file into an old subdirectory, before opening and returning a new
-// FLog instance at the original location.
+// backing log file into its configured old subdirectory using the same
+// rotateToOld naming/collision rules auto-rotation uses, before opening and
+// returning a new FLog instance at the original location, carrying forward
+// the original's Config so manually-rotated logs don't silently lose their
+// auto-rotation, retention sweeping, or async tuning.
 func Rotate(log FLog) FLog {
+	cfg := log.Config()
+	baseDir := log.BaseDir()
+	name := log.Name()
+
 	log.Close()
 
-	mkPath := path.Join(log.BaseDir(), "old")
+	oldDir := path.Join(baseDir, cfg.Rotate.OldDir)
+	mkdir(oldDir)
 
-	mkdir(mkPath)
+	newPath := uniqueRotatedPath(oldDir, name, cfg.Rotate)
+	oldPath := path.Join(baseDir, name+".log")
 
-	now := time.Now()
-	newPath := path.Join(
-		mkPath,
-		fmt.Sprintf(
-			"%d%d%d-%s.log",
-			now.Year(),
-			now.Month(),
-			now.Day(),
-			log.Name(),
-		),
-	)
-	oldPath := path.Join(
-		log.BaseDir(),
-		log.Name()+".log",
-	)
-
-	err := os.Rename(
-		oldPath,
-		newPath,
-	)
-
-	if err != nil {
+	if err := os.Rename(oldPath, newPath); err != nil {
 		panic(err)
 	}
 
@@ -156,10 +186,10 @@ func Rotate(log FLog) FLog {
 	bLog, ok := log.(*BufferedLog)
 
 	if ok {
-		newLog = New(log.Name(), log.BaseDir(), BufferedFile)
+		newLog = New(name, baseDir, BufferedFile, cfg)
 		newLog.(*BufferedLog).SetFlushIntervalSec(bLog.FlushIntervalSec())
 	} else {
-		newLog = New(log.Name(), log.BaseDir(), DirectFile)
+		newLog = New(name, baseDir, DirectFile, cfg)
 	}
 
 	return newLog
@@ -0,0 +1,249 @@
+//  ---------------------------------------------------------------------------
+//
+//  rotate.go
+//
+//  Copyright (c) 2014, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package flog
+
+import (
+	"github.com/xaevman/crash"
+	"github.com/xaevman/shutdown"
+
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Default values used to fill in a zero-valued RotateConfig.
+const (
+	// DefaultTimestampFormat is nanosecond-resolution so that rotations
+	// triggered faster than once per second - easily reached under a
+	// real MaxLines/MaxBytes threshold - don't collide on the same
+	// rotated filename. rotateToOld additionally guards against a
+	// collision directly, in case two rotations land on the same tick
+	// even at this resolution.
+	DefaultTimestampFormat  = "20060102-150405.000000000"
+	DefaultOldDir           = "old"
+	DefaultSweepIntervalSec = 3600
+)
+
+// RotateConfig controls automatic rotation and retention for an FLog
+// instance. A zero-valued RotateConfig disables every trigger, so auto
+// rotation remains opt-in and New's default, backwards-compatible
+// behavior is unchanged unless a caller supplies one.
+type RotateConfig struct {
+	// MaxBytes is the number of bytes written to the current log file
+	// that triggers rotation. Zero disables size-based rotation.
+	MaxBytes int64
+
+	// MaxLines is the number of lines written to the current log file
+	// that triggers rotation. Zero disables line-based rotation.
+	MaxLines int64
+
+	// Interval triggers rotation on a time boundary. Supported values
+	// are "daily", "hourly", and "" (disabled).
+	Interval string
+
+	// TimestampFormat is the time.Format layout used to name rotated
+	// files. Defaults to DefaultTimestampFormat.
+	TimestampFormat string
+
+	// OldDir is the subdirectory, relative to the log's base directory,
+	// that rotated files are moved into. Defaults to DefaultOldDir.
+	OldDir string
+
+	// MaxDays is the maximum age, in days, that a rotated file is kept
+	// before the retention sweeper removes it. Zero disables age-based
+	// retention.
+	MaxDays int
+
+	// MaxBackups is the maximum number of rotated files kept in OldDir.
+	// Zero disables count-based retention.
+	MaxBackups int
+
+	// SweepIntervalSec controls how often the retention sweeper checks
+	// OldDir. Defaults to DefaultSweepIntervalSec.
+	SweepIntervalSec int32
+}
+
+// DefaultRotateConfig returns a RotateConfig with every trigger disabled
+// and only the file-naming/sweep-cadence defaults filled in.
+func DefaultRotateConfig() RotateConfig {
+	return RotateConfig{
+		TimestampFormat:  DefaultTimestampFormat,
+		OldDir:           DefaultOldDir,
+		SweepIntervalSec: DefaultSweepIntervalSec,
+	}
+}
+
+// normalizeRotateConfig returns the supplied RotateConfig, if any, with
+// its zero-valued naming/cadence fields filled in from the defaults. With
+// no argument it returns DefaultRotateConfig() unchanged, i.e. rotation
+// disabled.
+func normalizeRotateConfig(cfg ...RotateConfig) RotateConfig {
+	c := DefaultRotateConfig()
+	if len(cfg) > 0 {
+		c.MaxBytes = cfg[0].MaxBytes
+		c.MaxLines = cfg[0].MaxLines
+		c.Interval = cfg[0].Interval
+		c.MaxDays = cfg[0].MaxDays
+		c.MaxBackups = cfg[0].MaxBackups
+
+		if cfg[0].TimestampFormat != "" {
+			c.TimestampFormat = cfg[0].TimestampFormat
+		}
+		if cfg[0].OldDir != "" {
+			c.OldDir = cfg[0].OldDir
+		}
+		if cfg[0].SweepIntervalSec > 0 {
+			c.SweepIntervalSec = cfg[0].SweepIntervalSec
+		}
+	}
+
+	return c
+}
+
+// shouldRotate reports whether any of cfg's configured thresholds have
+// been crossed.
+func shouldRotate(cfg RotateConfig, byteCount, lineCount int64, lastRotate, now time.Time) bool {
+	if cfg.MaxBytes > 0 && byteCount >= cfg.MaxBytes {
+		return true
+	}
+
+	if cfg.MaxLines > 0 && lineCount >= cfg.MaxLines {
+		return true
+	}
+
+	return intervalElapsed(cfg.Interval, lastRotate, now)
+}
+
+// intervalElapsed reports whether now has crossed a boundary of the given
+// interval ("daily" or "hourly") since lastRotate.
+func intervalElapsed(interval string, lastRotate, now time.Time) bool {
+	switch interval {
+	case "daily":
+		return now.Year() != lastRotate.Year() || now.YearDay() != lastRotate.YearDay()
+	case "hourly":
+		return now.Truncate(time.Hour).After(lastRotate.Truncate(time.Hour))
+	default:
+		return false
+	}
+}
+
+// rotateToOld closes f, moves it into baseDir/cfg.OldDir using
+// cfg.TimestampFormat, and opens and returns a fresh file at the original
+// path.
+func rotateToOld(f *os.File, baseDir, name string, cfg RotateConfig) (*os.File, error) {
+	f.Close()
+
+	oldDir := path.Join(baseDir, cfg.OldDir)
+	mkdir(oldDir)
+
+	newPath := uniqueRotatedPath(oldDir, name, cfg)
+	oldPath := path.Join(baseDir, name+".log")
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return nil, err
+	}
+
+	return os.OpenFile(
+		path.Join(baseDir, name+".log"),
+		FLogOpenFlags,
+		0660,
+	)
+}
+
+// uniqueRotatedPath returns a not-yet-existing destination path for a
+// rotated copy of name in oldDir, guarding against two rotations landing
+// on the same cfg.TimestampFormat tick by appending a counter suffix
+// until the path is free.
+func uniqueRotatedPath(oldDir, name string, cfg RotateConfig) string {
+	ts := time.Now().Format(cfg.TimestampFormat)
+
+	newPath := path.Join(oldDir, fmt.Sprintf("%s-%s.log", ts, name))
+	for i := 1; fileExists(newPath); i++ {
+		newPath = path.Join(oldDir, fmt.Sprintf("%s-%d-%s.log", ts, i, name))
+	}
+
+	return newPath
+}
+
+// fileExists reports whether path names an existing file.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// startRetentionSweeper launches a background goroutine that periodically
+// removes rotated log files from baseDir/cfg.OldDir once they exceed the
+// configured MaxDays age or MaxBackups count. It is a no-op when neither
+// is configured, and exits once sd.Signal is closed.
+func startRetentionSweeper(sd *shutdown.Sync, baseDir, name string, cfg RotateConfig) {
+	if cfg.MaxDays <= 0 && cfg.MaxBackups <= 0 {
+		return
+	}
+
+	interval := time.Duration(cfg.SweepIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = DefaultSweepIntervalSec * time.Second
+	}
+
+	go func() {
+		defer crash.HandleAll()
+		defer sd.Complete()
+
+		for {
+			select {
+			case <-sd.Signal:
+				return
+			case <-time.After(interval):
+				sweepOldLogs(baseDir, name, cfg)
+			}
+		}
+	}()
+}
+
+// sweepOldLogs removes rotated files belonging to name from
+// baseDir/cfg.OldDir that exceed cfg's MaxDays or MaxBackups retention.
+func sweepOldLogs(baseDir, name string, cfg RotateConfig) {
+	matches, err := filepath.Glob(path.Join(baseDir, cfg.OldDir, "*-"+name+".log"))
+	if err != nil {
+		return
+	}
+
+	// Timestamp-prefixed names sort oldest-first.
+	sort.Strings(matches)
+
+	if cfg.MaxBackups > 0 && len(matches) > cfg.MaxBackups {
+		stale := matches[:len(matches)-cfg.MaxBackups]
+		for _, f := range stale {
+			os.Remove(f)
+		}
+		matches = matches[len(matches)-cfg.MaxBackups:]
+	}
+
+	if cfg.MaxDays <= 0 {
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -cfg.MaxDays)
+	for _, f := range matches {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(f)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+//  ---------------------------------------------------------------------------
+//
+//  formatter.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Formatter renders a LogMsg to its on-the-wire byte representation. Every
+// log sink (BufferedLog, DirectLog, ConsoleLog) starts out with
+// TextFormatter; no constructor takes a Formatter, and a different one is
+// set afterward via that sink's SetFormatter method. Every write
+// the sink makes, both to its backing file and to the stdlib log mirror,
+// renders through the same Formatter call.
+type Formatter interface {
+	Format(msg *LogMsg) []byte
+}
+
+// TextFormatter renders a LogMsg using the package's original plain-text
+// layout (see LogMsg.String). It is the default Formatter for every log
+// sink.
+type TextFormatter struct{}
+
+// Format implements the Formatter interface.
+func (TextFormatter) Format(msg *LogMsg) []byte {
+	return []byte(msg.String())
+}
+
+// jsonLogMsg mirrors LogMsg's exported fields with stable, lowercase
+// JSON field names for ingestion by external log shippers.
+type jsonLogMsg struct {
+	Timestamp string                 `json:"timestamp"`
+	Level     string                 `json:"level"`
+	Name      string                 `json:"name"`
+	File      string                 `json:"file,omitempty"`
+	Line      int                    `json:"line,omitempty"`
+	Func      string                 `json:"func,omitempty"`
+	Message   string                 `json:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// JSONFormatter renders a LogMsg as a single-line JSON object, suitable
+// for ingestion by log shippers that expect structured input.
+type JSONFormatter struct{}
+
+// Format implements the Formatter interface.
+func (JSONFormatter) Format(msg *LogMsg) []byte {
+	out, err := json.Marshal(jsonLogMsg{
+		Timestamp: msg.Timestamp.Format(timeFormat),
+		Level:     msg.Level.String(),
+		Name:      msg.Name,
+		File:      msg.File,
+		Line:      msg.Line,
+		Func:      msg.Func,
+		Message:   strings.TrimSuffix(msg.Message, "\n"),
+		Fields:    msg.Fields,
+	})
+	if err != nil {
+		out = []byte(fmt.Sprintf(`{"error":%q}`, err.Error()))
+	}
+
+	return append(out, '\n')
+}
+
+// templateWriterFunc renders one piece of a compiled TemplateFormatter,
+// either a literal run of bytes or a field substitution, into buffer.
+type templateWriterFunc func(buffer *bytes.Buffer, msg *LogMsg)
+
+// templateVerb pairs a format-string verb with the writer func that
+// renders it. Order matters only in that no verb here is a prefix of
+// another, so first-match-wins during compilation is unambiguous.
+type templateVerb struct {
+	verb   string
+	writer templateWriterFunc
+}
+
+var templateVerbs = []templateVerb{
+	{"%Date", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(msg.Timestamp.Format("2006/01/02")) }},
+	{"%Time", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(msg.Timestamp.Format("15:04:05.0000")) }},
+	{"%Level", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(msg.Level.String()) }},
+	{"%Name", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(strings.ToUpper(msg.Name)) }},
+	{"%File", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(msg.File) }},
+	{"%Line", func(b *bytes.Buffer, msg *LogMsg) { fmt.Fprintf(b, "%d", msg.Line) }},
+	{"%Func", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(msg.Func) }},
+	{"%Msg", func(b *bytes.Buffer, msg *LogMsg) { b.WriteString(strings.TrimSuffix(msg.Message, "\n")) }},
+	{"%Ns", func(b *bytes.Buffer, msg *LogMsg) { fmt.Fprintf(b, "%09d", msg.Timestamp.Nanosecond()) }},
+}
+
+// TemplateFormatter renders a LogMsg using a format string built from the
+// verbs %Date, %Time, %Level, %Name, %File, %Line, %Func, %Msg, and %Ns.
+// The format string is compiled once, by NewTemplateFormatter, into a
+// slice of writer funcs, so formatting a message at log time costs no
+// per-call parsing.
+type TemplateFormatter struct {
+	writers []templateWriterFunc
+}
+
+// NewTemplateFormatter compiles format into a *TemplateFormatter. Any '%'
+// sequence that doesn't match a known verb is emitted as literal text.
+func NewTemplateFormatter(format string) *TemplateFormatter {
+	tf := &TemplateFormatter{}
+
+	remaining := format
+	for len(remaining) > 0 {
+		idx := strings.IndexByte(remaining, '%')
+		if idx < 0 {
+			tf.writers = append(tf.writers, literalWriter(remaining))
+			break
+		}
+
+		if idx > 0 {
+			tf.writers = append(tf.writers, literalWriter(remaining[:idx]))
+			remaining = remaining[idx:]
+		}
+
+		if w, n := matchTemplateVerb(remaining); w != nil {
+			tf.writers = append(tf.writers, w)
+			remaining = remaining[n:]
+			continue
+		}
+
+		tf.writers = append(tf.writers, literalWriter(remaining[:1]))
+		remaining = remaining[1:]
+	}
+
+	tf.writers = append(tf.writers, func(b *bytes.Buffer, _ *LogMsg) { b.WriteByte('\n') })
+
+	return tf
+}
+
+// matchTemplateVerb returns the writer for the verb at the start of s, if
+// any, along with the number of bytes it consumed.
+func matchTemplateVerb(s string) (templateWriterFunc, int) {
+	for _, tv := range templateVerbs {
+		if strings.HasPrefix(s, tv.verb) {
+			return tv.writer, len(tv.verb)
+		}
+	}
+
+	return nil, 0
+}
+
+// literalWriter returns a templateWriterFunc that writes s verbatim.
+func literalWriter(s string) templateWriterFunc {
+	b := []byte(s)
+	return func(buf *bytes.Buffer, _ *LogMsg) {
+		buf.Write(b)
+	}
+}
+
+// Format implements the Formatter interface.
+func (tf *TemplateFormatter) Format(msg *LogMsg) []byte {
+	var buf bytes.Buffer
+
+	for _, w := range tf.writers {
+		w(&buf, msg)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,70 @@
+//  ---------------------------------------------------------------------------
+//
+//  formatter_test.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestJSONFormatter verifies that JSONFormatter produces a single valid
+// JSON object per message, carrying the message's Fields through.
+func TestJSONFormatter(t *testing.T) {
+	msg := NewLogMsgWithFields(
+		"test",
+		map[string]interface{}{"count": 3},
+		"hello %s",
+		2,
+		"world",
+	)
+	msg.Level = LevelInfo
+
+	out := JSONFormatter{}.Format(msg)
+	if !strings.HasSuffix(string(out), "\n") {
+		t.Error("expected JSONFormatter output to end with a newline")
+	}
+
+	var decoded jsonLogMsg
+	if err := json.Unmarshal(out, &decoded); err != nil {
+		t.Fatalf("failed to decode JSONFormatter output: %v", err)
+	}
+
+	if decoded.Message != "hello world" {
+		t.Errorf("expected message %q, got %q", "hello world", decoded.Message)
+	}
+
+	if decoded.Level != "INFO" {
+		t.Errorf("expected level %q, got %q", "INFO", decoded.Level)
+	}
+
+	if decoded.Fields["count"].(float64) != 3 {
+		t.Errorf("expected fields.count == 3, got %v", decoded.Fields["count"])
+	}
+}
+
+// TestTemplateFormatter verifies that a compiled TemplateFormatter
+// substitutes verbs and leaves surrounding literal text untouched.
+func TestTemplateFormatter(t *testing.T) {
+	tf := NewTemplateFormatter("[%Level] %Name: %Msg")
+
+	msg := NewLogMsg("test", "hello %s", 2, "world")
+	msg.Level = LevelWarn
+
+	out := string(tf.Format(msg))
+
+	want := "[WARN] TEST: hello world\n"
+	if out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+}
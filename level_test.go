@@ -0,0 +1,79 @@
+//  ---------------------------------------------------------------------------
+//
+//  level_test.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestLevelFilterConcurrent races concurrent SetLevel calls against
+// concurrent Print calls on a LogBuffer and verifies that, once settled
+// on LevelError, a LevelDebug message printed afterward is dropped.
+func TestLevelFilterConcurrent(t *testing.T) {
+	buf := NewLogBuffer(256)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+
+		go func(n int) {
+			defer wg.Done()
+			buf.SetLevel(Level(n % 4))
+		}(i)
+
+		go func(n int) {
+			defer wg.Done()
+			buf.Print(NewLogMsgWithLevel("test", Level(n%4), "msg %d", 2, n))
+		}(i)
+	}
+
+	wg.Wait()
+
+	buf.SetLevel(LevelError)
+	buf.Print(NewLogMsgWithLevel("test", LevelDebug, "should be dropped", 2))
+
+	for _, m := range buf.ReadAll() {
+		if m.Message == "should be dropped" {
+			t.Error("message above the configured level threshold was not filtered")
+		}
+	}
+}
+
+// TestSetModuleLevels verifies that a per-module override takes priority
+// over the package-wide threshold, and that clearing the spec removes it.
+func TestSetModuleLevels(t *testing.T) {
+	defer SetLevel(GetLevel())
+	defer SetModuleLevels("")
+
+	SetLevel(LevelError)
+
+	if err := SetModuleLevels("level_test=3"); err != nil {
+		t.Fatal(err)
+	}
+
+	v := V(LevelDebug)
+	if !v.enabled {
+		t.Error("expected module override to enable LevelDebug verbosity")
+	}
+
+	if err := SetModuleLevels(""); err != nil {
+		t.Fatal(err)
+	}
+
+	v = V(LevelDebug)
+	if v.enabled {
+		t.Error("expected package-wide LevelError threshold to suppress LevelDebug verbosity")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -45,6 +46,9 @@ type LogMsg struct {
 	Name      string
 	File      string
 	Line      int
+	Func      string
+	Level     Level
+	Fields    map[string]interface{}
 	Message   string
 }
 
@@ -101,6 +105,7 @@ type LogToggler interface {
 type LogBuffer struct {
 	changed bool
 	enabled bool
+	level   int32
 	lock    sync.RWMutex
 	logs    *ring.Ring
 }
@@ -109,6 +114,7 @@ type LogBuffer struct {
 func NewLogBuffer(maxSize int) *LogBuffer {
 	logBuffer := &LogBuffer{
 		enabled: true,
+		level:   int32(LevelDebug),
 		logs:    ring.New(maxSize),
 	}
 
@@ -127,8 +133,13 @@ func (this *LogBuffer) HasChanged() bool {
 // Print formats and adds a new message to the log buffer. If the new
 // message causes the log buffer to grow larger than its maxSize, it
 // truncates the end oldest entry in the buffer. Once the message is
-// stored, the changed flag is set to true.
+// stored, the changed flag is set to true. Messages whose Level exceeds
+// the buffer's configured threshold (see SetLevel) are dropped.
 func (this *LogBuffer) Print(msg *LogMsg) {
+	if msg.Level > Level(atomic.LoadInt32(&this.level)) {
+		return
+	}
+
 	this.lock.Lock()
 	defer this.lock.Unlock()
 
@@ -142,6 +153,12 @@ func (this *LogBuffer) Print(msg *LogMsg) {
 	this.changed = true
 }
 
+// SetLevel sets this buffer's per-instance verbosity threshold. Messages
+// with a higher Level are dropped by Print.
+func (this *LogBuffer) SetLevel(l Level) {
+	atomic.StoreInt32(&this.level, int32(l))
+}
+
 // ReadAll returns a list of all log messages currently in the buffer.
 func (this *LogBuffer) ReadAll() []*LogMsg {
 	this.lock.RLock()
@@ -203,11 +220,35 @@ func NewLogMsg(name, format string, callDepth int, v ...interface{}) *LogMsg {
 		Message:   msg,
 	}
 
-	_, file, line, ok := runtime.Caller(callDepth)
+	pc, file, line, ok := runtime.Caller(callDepth)
 	if ok {
 		newLog.File = filepath.Base(file)
 		newLog.Line = line
+
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			newLog.Func = fn.Name()
+		}
 	}
 
 	return newLog
 }
+
+// NewLogMsgWithLevel behaves like NewLogMsg, additionally tagging the
+// resulting LogMsg with an explicit Level so that leveled sinks (see
+// Level, SetLevel, V) can filter it.
+func NewLogMsgWithLevel(name string, level Level, format string, callDepth int, v ...interface{}) *LogMsg {
+	newLog := NewLogMsg(name, format, callDepth+1, v...)
+	newLog.Level = level
+
+	return newLog
+}
+
+// NewLogMsgWithFields behaves like NewLogMsg, additionally attaching
+// structured key/value Fields for formatters that support them (see
+// JSONFormatter).
+func NewLogMsgWithFields(name string, fields map[string]interface{}, format string, callDepth int, v ...interface{}) *LogMsg {
+	newLog := NewLogMsg(name, format, callDepth+1, v...)
+	newLog.Fields = fields
+
+	return newLog
+}
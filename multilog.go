@@ -0,0 +1,253 @@
+//  ---------------------------------------------------------------------------
+//
+//  multilog.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSinkQueueDepth is the capacity of a sink's message queue when
+// SinkOptions.QueueDepth is left unset.
+const DefaultSinkQueueDepth = 256
+
+// SinkOptions configures an individual sink registered with
+// MultiLog.AddSink.
+type SinkOptions struct {
+	// Level is the sink's minimum verbosity threshold; messages more
+	// verbose than Level are never delivered to it. The zero value,
+	// LevelError, only delivers errors - callers wanting INFO or DEBUG
+	// output from a sink must set this explicitly.
+	Level Level
+
+	// NameFilter, if non-empty, is a filepath.Match glob (e.g.
+	// "error.*") matched against LogMsg.Name. Only matching messages
+	// are delivered to the sink. An empty NameFilter matches every
+	// name.
+	NameFilter string
+
+	// QueueDepth is the capacity of the sink's message queue. Defaults
+	// to DefaultSinkQueueDepth.
+	QueueDepth int
+}
+
+// multiSink wraps a single LogNotify registered with a MultiLog, running
+// its own goroutine and bounded queue so that a slow or panicking sink
+// can't block or kill delivery to the others.
+type multiSink struct {
+	dropped int64
+	filter  string
+	level   int32
+	name    string
+	queue   chan *LogMsg
+	sink    LogNotify
+	stop    chan struct{}
+}
+
+func newMultiSink(name string, sink LogNotify, opts SinkOptions) *multiSink {
+	depth := opts.QueueDepth
+	if depth < 1 {
+		depth = DefaultSinkQueueDepth
+	}
+
+	return &multiSink{
+		filter: opts.NameFilter,
+		level:  int32(opts.Level),
+		name:   name,
+		queue:  make(chan *LogMsg, depth),
+		sink:   sink,
+		stop:   make(chan struct{}),
+	}
+}
+
+// matches reports whether msg clears this sink's Level threshold and, if
+// configured, its NameFilter glob.
+func (this *multiSink) matches(msg *LogMsg) bool {
+	if msg.Level > Level(atomic.LoadInt32(&this.level)) {
+		return false
+	}
+
+	if this.filter == "" {
+		return true
+	}
+
+	ok, err := filepath.Match(this.filter, msg.Name)
+	return err == nil && ok
+}
+
+// enqueue hands msg to this sink's goroutine, dropping and counting it if
+// the sink's queue is currently full.
+func (this *multiSink) enqueue(msg *LogMsg) {
+	select {
+	case this.queue <- msg:
+	default:
+		atomic.AddInt64(&this.dropped, 1)
+	}
+}
+
+// run delivers queued messages to the sink one at a time until stop is
+// closed.
+func (this *multiSink) run() {
+	for {
+		select {
+		case <-this.stop:
+			return
+		case msg := <-this.queue:
+			this.write(msg)
+		}
+	}
+}
+
+// write delivers a single message to the sink, recovering and counting a
+// dropped message if the sink's Print panics, so one bad sink can't take
+// down the others.
+func (this *multiSink) write(msg *LogMsg) {
+	defer func() {
+		if recover() != nil {
+			atomic.AddInt64(&this.dropped, 1)
+		}
+	}()
+
+	this.sink.Print(msg)
+}
+
+// Dropped returns the number of messages this sink has discarded, either
+// because its queue was full or because its Print panicked.
+func (this *multiSink) Dropped() int64 {
+	return atomic.LoadInt64(&this.dropped)
+}
+
+// MultiLog fans a single Print out to any number of registered sinks, each
+// with its own minimum Level and optional name filter. MultiLog implements
+// LogNotify, LogCloser, and LogToggler, so it can stand in anywhere a
+// single log sink is expected.
+type MultiLog struct {
+	enabled int32
+	lock    sync.RWMutex
+	sinks   map[string]*multiSink
+}
+
+// NewMultiLog returns a new, enabled MultiLog with no sinks registered.
+func NewMultiLog() *MultiLog {
+	return &MultiLog{
+		enabled: 1,
+		sinks:   make(map[string]*multiSink),
+	}
+}
+
+// AddSink registers sink under name, delivered to via its own goroutine and
+// bounded queue per opts. It returns an error if name is empty, a sink is
+// already registered under name, or opts.NameFilter isn't a valid
+// filepath.Match pattern.
+func (this *MultiLog) AddSink(name string, sink LogNotify, opts SinkOptions) error {
+	if name == "" {
+		return fmt.Errorf("log: sink name must not be empty")
+	}
+
+	if opts.NameFilter != "" {
+		if _, err := filepath.Match(opts.NameFilter, ""); err != nil {
+			return fmt.Errorf("log: invalid name filter %q: %v", opts.NameFilter, err)
+		}
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	if _, exists := this.sinks[name]; exists {
+		return fmt.Errorf("log: sink %q is already registered", name)
+	}
+
+	ms := newMultiSink(name, sink, opts)
+	this.sinks[name] = ms
+
+	go ms.run()
+
+	return nil
+}
+
+// RemoveSink stops delivering to and unregisters the sink registered under
+// name. It is a no-op if no sink is registered under name. The underlying
+// sink itself is not closed; callers that also want it closed should do so
+// themselves.
+func (this *MultiLog) RemoveSink(name string) {
+	this.lock.Lock()
+	ms, ok := this.sinks[name]
+	if ok {
+		delete(this.sinks, name)
+	}
+	this.lock.Unlock()
+
+	if ok {
+		close(ms.stop)
+	}
+}
+
+// SinkDropped returns the number of messages dropped by the sink
+// registered under name, or 0 if no sink is registered under that name.
+func (this *MultiLog) SinkDropped(name string) int64 {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	ms, ok := this.sinks[name]
+	if !ok {
+		return 0
+	}
+
+	return ms.Dropped()
+}
+
+// Print fans msg out to every registered sink whose Level and NameFilter
+// allow it, as long as the MultiLog itself is enabled. Delivery to each
+// sink happens on that sink's own goroutine, so Print never blocks on a
+// slow sink.
+func (this *MultiLog) Print(msg *LogMsg) {
+	if atomic.LoadInt32(&this.enabled) == 0 {
+		return
+	}
+
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+
+	for _, ms := range this.sinks {
+		if ms.matches(msg) {
+			ms.enqueue(msg)
+		}
+	}
+}
+
+// SetEnabled temporarily enables/disables fan-out. Disabled messages are
+// dropped by Print without reaching any sink or incrementing its dropped
+// counter.
+func (this *MultiLog) SetEnabled(enabled bool) {
+	v := int32(0)
+	if enabled {
+		v = 1
+	}
+
+	atomic.StoreInt32(&this.enabled, v)
+}
+
+// Close stops every registered sink's delivery goroutine and removes it.
+// It does not close the underlying sinks themselves.
+func (this *MultiLog) Close() {
+	this.lock.Lock()
+	sinks := this.sinks
+	this.sinks = make(map[string]*multiSink)
+	this.lock.Unlock()
+
+	for _, ms := range sinks {
+		close(ms.stop)
+	}
+}
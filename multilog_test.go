@@ -0,0 +1,177 @@
+//  ---------------------------------------------------------------------------
+//
+//  multilog_test.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingSink is a simple LogNotify that appends every delivered message
+// to a slice, guarded by a mutex since MultiLog delivers concurrently.
+type recordingSink struct {
+	lock sync.Mutex
+	msgs []*LogMsg
+}
+
+func (this *recordingSink) Print(msg *LogMsg) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	this.msgs = append(this.msgs, msg)
+}
+
+func (this *recordingSink) Len() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+
+	return len(this.msgs)
+}
+
+// panicSink always panics on Print, to exercise MultiLog's per-sink error
+// isolation.
+type panicSink struct{}
+
+func (panicSink) Print(msg *LogMsg) {
+	panic("panicSink always panics")
+}
+
+// waitFor polls cond until it returns true or the timeout elapses, failing
+// t if the timeout is hit first.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if !cond() {
+		t.Fatal("timed out waiting for condition")
+	}
+}
+
+// TestMultiLogLevelFilter verifies that a sink only receives messages at
+// or below its configured Level.
+func TestMultiLogLevelFilter(t *testing.T) {
+	ml := NewMultiLog()
+	defer ml.Close()
+
+	sink := &recordingSink{}
+	if err := ml.AddSink("errors", sink, SinkOptions{Level: LevelError}); err != nil {
+		t.Fatal(err)
+	}
+
+	ml.Print(NewLogMsgWithLevel("test", LevelInfo, "info message", 2))
+	ml.Print(NewLogMsgWithLevel("test", LevelError, "error message", 2))
+
+	waitFor(t, time.Second, func() bool { return sink.Len() == 1 })
+
+	if sink.Len() != 1 {
+		t.Fatalf("expected 1 delivered message, got %d", sink.Len())
+	}
+}
+
+// TestMultiLogNameFilter verifies that a sink only receives messages whose
+// Name matches its configured glob.
+func TestMultiLogNameFilter(t *testing.T) {
+	ml := NewMultiLog()
+	defer ml.Close()
+
+	sink := &recordingSink{}
+	if err := ml.AddSink("errs", sink, SinkOptions{Level: LevelDebug, NameFilter: "error*"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ml.Print(NewLogMsgWithLevel("info", LevelDebug, "info message", 2))
+	ml.Print(NewLogMsgWithLevel("errorLog", LevelDebug, "error message", 2))
+
+	waitFor(t, time.Second, func() bool { return sink.Len() == 1 })
+
+	if sink.Len() != 1 {
+		t.Fatalf("expected 1 delivered message, got %d", sink.Len())
+	}
+}
+
+// TestMultiLogSinkIsolation verifies that a panicking sink doesn't prevent
+// delivery to other registered sinks, and that its dropped counter grows.
+func TestMultiLogSinkIsolation(t *testing.T) {
+	ml := NewMultiLog()
+	defer ml.Close()
+
+	good := &recordingSink{}
+	if err := ml.AddSink("good", good, SinkOptions{Level: LevelDebug}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ml.AddSink("bad", panicSink{}, SinkOptions{Level: LevelDebug}); err != nil {
+		t.Fatal(err)
+	}
+
+	ml.Print(NewLogMsgWithLevel("test", LevelDebug, "msg", 2))
+
+	waitFor(t, time.Second, func() bool { return good.Len() == 1 })
+	waitFor(t, time.Second, func() bool { return ml.SinkDropped("bad") == 1 })
+
+	if good.Len() != 1 {
+		t.Fatalf("expected the healthy sink to receive 1 message, got %d", good.Len())
+	}
+	if ml.SinkDropped("bad") != 1 {
+		t.Fatalf("expected the panicking sink's dropped count to be 1, got %d", ml.SinkDropped("bad"))
+	}
+}
+
+// TestMultiLogAddSinkErrors verifies AddSink's validation.
+func TestMultiLogAddSinkErrors(t *testing.T) {
+	ml := NewMultiLog()
+	defer ml.Close()
+
+	if err := ml.AddSink("", &recordingSink{}, SinkOptions{}); err == nil {
+		t.Error("expected an error registering a sink with an empty name")
+	}
+
+	if err := ml.AddSink("dup", &recordingSink{}, SinkOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ml.AddSink("dup", &recordingSink{}, SinkOptions{}); err == nil {
+		t.Error("expected an error registering a duplicate sink name")
+	}
+
+	if err := ml.AddSink("badfilter", &recordingSink{}, SinkOptions{NameFilter: "["}); err == nil {
+		t.Error("expected an error registering a sink with a malformed name filter")
+	}
+}
+
+// TestMultiLogRemoveSink verifies that RemoveSink stops further delivery.
+func TestMultiLogRemoveSink(t *testing.T) {
+	ml := NewMultiLog()
+	defer ml.Close()
+
+	sink := &recordingSink{}
+	if err := ml.AddSink("temp", sink, SinkOptions{Level: LevelDebug}); err != nil {
+		t.Fatal(err)
+	}
+
+	ml.Print(NewLogMsgWithLevel("test", LevelDebug, "msg 1", 2))
+	waitFor(t, time.Second, func() bool { return sink.Len() == 1 })
+
+	ml.RemoveSink("temp")
+
+	ml.Print(NewLogMsgWithLevel("test", LevelDebug, "msg 2", 2))
+	time.Sleep(20 * time.Millisecond)
+
+	if sink.Len() != 1 {
+		t.Fatalf("expected no further delivery after RemoveSink, got %d messages", sink.Len())
+	}
+}
@@ -0,0 +1,204 @@
+//  ---------------------------------------------------------------------------
+//
+//  sampler.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// summaryTick is how long an EveryN sampler waits after a call site's last
+// summary before a suppressed message, rather than only the next allowed
+// one, carries that call site's suppressed-message count out. The check
+// happens only inside Allow; there is no background timer.
+const summaryTick = 10 * time.Second
+
+// Sampler decides, call site by call site, whether a LogMsg should be
+// emitted. It sits in front of a log's Print method (see
+// flog.BufferedLog.SetSampler and flog.DirectLog.SetSampler), letting a
+// single noisy call site be throttled without silencing the rest of the
+// log.
+type Sampler interface {
+	// Allow reports whether msg should be emitted. It may additionally
+	// return a non-nil summary LogMsg - for example, a suppressed-count
+	// roll-up - that the caller should emit in addition to msg. summary
+	// is only ever non-nil when ok is true for roll-over summaries, or
+	// when ok is false for a standalone tick summary.
+	Allow(msg *LogMsg) (ok bool, summary *LogMsg)
+}
+
+// callSiteKey returns the sync.Map key a Sampler uses to track a LogMsg's
+// call site: its file and line number.
+func callSiteKey(msg *LogMsg) string {
+	return fmt.Sprintf("%s:%d", msg.File, msg.Line)
+}
+
+// everyNCounter tracks one call site's occurrence count, suppressed-entry
+// count, and the last time a summary was emitted for it.
+type everyNCounter struct {
+	count      int64
+	suppressed int64
+	lastEmit   int64 // unix nano
+}
+
+// everyNSampler implements EveryN.
+type everyNSampler struct {
+	n        int64
+	counters sync.Map // string -> *everyNCounter
+}
+
+// EveryN returns a Sampler that emits the 1st, and then every Nth,
+// occurrence of a message from a given call site (keyed by
+// LogMsg.File:LogMsg.Line). Messages suppressed in between are counted; a
+// summary line of the form "[... suppressed N repeated messages ...]" is
+// emitted alongside the next allowed message, or alongside the next
+// suppressed one once 10 seconds have passed since the call site's last
+// summary. Summaries are only produced from Allow, so a call site that
+// stops logging leaves its remaining suppressed count unreported. n <= 1
+// allows every message.
+func EveryN(n int) Sampler {
+	if n < 1 {
+		n = 1
+	}
+
+	return &everyNSampler{n: int64(n)}
+}
+
+func (this *everyNSampler) Allow(msg *LogMsg) (bool, *LogMsg) {
+	key := callSiteKey(msg)
+
+	v, _ := this.counters.LoadOrStore(key, &everyNCounter{
+		lastEmit: time.Now().UnixNano(),
+	})
+	counter := v.(*everyNCounter)
+
+	now := time.Now()
+	count := atomic.AddInt64(&counter.count, 1)
+
+	// count is 1-based: the 1st occurrence, and every Nth one after it,
+	// is allowed through.
+	if (count-1)%this.n == 0 {
+		return true, drainSuppressed(counter, msg, now)
+	}
+
+	atomic.AddInt64(&counter.suppressed, 1)
+
+	last := time.Unix(0, atomic.LoadInt64(&counter.lastEmit))
+	if now.Sub(last) >= summaryTick {
+		return false, drainSuppressed(counter, msg, now)
+	}
+
+	return false, nil
+}
+
+// drainSuppressed resets counter's suppressed count to zero and, if it was
+// non-zero, returns a summary LogMsg reporting it.
+func drainSuppressed(counter *everyNCounter, msg *LogMsg, now time.Time) *LogMsg {
+	atomic.StoreInt64(&counter.lastEmit, now.UnixNano())
+
+	suppressed := atomic.SwapInt64(&counter.suppressed, 0)
+	if suppressed == 0 {
+		return nil
+	}
+
+	return &LogMsg{
+		Timestamp: now,
+		Name:      msg.Name,
+		File:      msg.File,
+		Line:      msg.Line,
+		Level:     msg.Level,
+		Message:   fmt.Sprintf("[... suppressed %d repeated messages ...]", suppressed),
+	}
+}
+
+// tokenBucket is a single call site's token bucket state for RateLimit.
+type tokenBucket struct {
+	lock       sync.Mutex
+	tokens     float64
+	lastRefill int64 // unix nano
+	suppressed int64
+}
+
+// rateLimitSampler implements RateLimit.
+type rateLimitSampler struct {
+	rate    float64
+	burst   float64
+	buckets sync.Map // string -> *tokenBucket
+}
+
+// RateLimit returns a Sampler that allows up to r messages/sec, per call
+// site, with a burst capacity of burst. Messages exceeding the rate are
+// dropped and counted, but otherwise silently; no summary message is
+// emitted.
+func RateLimit(r float64, burst int) Sampler {
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &rateLimitSampler{
+		rate:  r,
+		burst: float64(burst),
+	}
+}
+
+func (this *rateLimitSampler) Allow(msg *LogMsg) (bool, *LogMsg) {
+	key := callSiteKey(msg)
+
+	v, _ := this.buckets.LoadOrStore(key, &tokenBucket{
+		tokens:     this.burst,
+		lastRefill: time.Now().UnixNano(),
+	})
+	bucket := v.(*tokenBucket)
+
+	bucket.lock.Lock()
+	defer bucket.lock.Unlock()
+
+	now := time.Now().UnixNano()
+	elapsedSec := float64(now-bucket.lastRefill) / float64(time.Second)
+	bucket.lastRefill = now
+
+	bucket.tokens += elapsedSec * this.rate
+	if bucket.tokens > this.burst {
+		bucket.tokens = this.burst
+	}
+
+	if bucket.tokens < 1 {
+		bucket.suppressed++
+		return false, nil
+	}
+
+	bucket.tokens--
+
+	return true, nil
+}
+
+// Dropped returns the total number of messages this RateLimit sampler has
+// suppressed for exceeding their call site's rate limit, summed across
+// every call site it's tracking.
+func (this *rateLimitSampler) Dropped() int64 {
+	var total int64
+
+	this.buckets.Range(func(_, v interface{}) bool {
+		bucket := v.(*tokenBucket)
+
+		bucket.lock.Lock()
+		total += bucket.suppressed
+		bucket.lock.Unlock()
+
+		return true
+	})
+
+	return total
+}
@@ -0,0 +1,135 @@
+//  ---------------------------------------------------------------------------
+//
+//  sampler_test.go
+//
+//  Copyright (c) 2015, Jared Chavez.
+//  All rights reserved.
+//
+//  Use of this source code is governed by a BSD-style
+//  license that can be found in the LICENSE file.
+//
+//  -----------
+
+package log
+
+import "testing"
+
+// TestEveryNSampler verifies that EveryN emits the 1st and every Nth
+// message from a call site, suppressing the rest, and rolls over into a
+// suppressed-count summary.
+func TestEveryNSampler(t *testing.T) {
+	s := EveryN(3)
+	msg := &LogMsg{Name: "test", File: "sampler_test.go", Line: 100}
+
+	var allowed int
+	var summary *LogMsg
+
+	for i := 0; i < 7; i++ {
+		ok, sum := s.Allow(msg)
+		if ok {
+			allowed++
+		}
+		if sum != nil {
+			summary = sum
+		}
+	}
+
+	// occurrences 1, 4, 7 are allowed out of 7
+	if allowed != 3 {
+		t.Errorf("expected 3 allowed messages, got %d", allowed)
+	}
+
+	if summary == nil {
+		t.Fatal("expected a suppressed-count summary to roll in with an allowed message")
+	}
+
+	if summary.Message != "[... suppressed 2 repeated messages ...]" {
+		t.Errorf("unexpected summary message: %q", summary.Message)
+	}
+}
+
+// TestEveryNSamplerIsolatesCallSites verifies that two different call
+// sites (distinct File:Line) are sampled independently.
+func TestEveryNSamplerIsolatesCallSites(t *testing.T) {
+	s := EveryN(2)
+
+	msgA := &LogMsg{Name: "test", File: "a.go", Line: 1}
+	msgB := &LogMsg{Name: "test", File: "b.go", Line: 1}
+
+	okA1, _ := s.Allow(msgA)
+	okB1, _ := s.Allow(msgB)
+	okA2, _ := s.Allow(msgA)
+	okB2, _ := s.Allow(msgB)
+
+	if !okA1 || !okB1 {
+		t.Error("expected the 1st occurrence at each call site to be allowed")
+	}
+
+	if okA2 || okB2 {
+		t.Error("expected the 2nd occurrence at each call site to be suppressed")
+	}
+}
+
+// TestRateLimitSampler verifies that RateLimit allows up to burst messages
+// immediately, then drops further messages from the same call site until
+// tokens replenish.
+func TestRateLimitSampler(t *testing.T) {
+	s := RateLimit(1, 2)
+	msg := &LogMsg{Name: "test", File: "sampler_test.go", Line: 200}
+
+	var allowed int
+	for i := 0; i < 5; i++ {
+		ok, _ := s.Allow(msg)
+		if ok {
+			allowed++
+		}
+	}
+
+	if allowed != 2 {
+		t.Errorf("expected burst of 2 messages to be allowed, got %d", allowed)
+	}
+}
+
+// TestRateLimitSamplerIsolatesCallSites verifies that two different call
+// sites don't share a token bucket.
+func TestRateLimitSamplerIsolatesCallSites(t *testing.T) {
+	s := RateLimit(1, 1)
+
+	msgA := &LogMsg{Name: "test", File: "a.go", Line: 1}
+	msgB := &LogMsg{Name: "test", File: "b.go", Line: 1}
+
+	okA, _ := s.Allow(msgA)
+	okB, _ := s.Allow(msgB)
+
+	if !okA || !okB {
+		t.Error("expected each call site's first message to be allowed from its own bucket")
+	}
+
+	okA2, _ := s.Allow(msgA)
+	if okA2 {
+		t.Error("expected call site A's burst to be exhausted by its own traffic")
+	}
+}
+
+// TestRateLimitSamplerDropped verifies that Dropped reports the number of
+// messages suppressed for exceeding the rate limit, summed across call
+// sites.
+func TestRateLimitSamplerDropped(t *testing.T) {
+	s := RateLimit(1, 1).(*rateLimitSampler)
+
+	msgA := &LogMsg{Name: "test", File: "a.go", Line: 1}
+	msgB := &LogMsg{Name: "test", File: "b.go", Line: 1}
+
+	for i := 0; i < 3; i++ {
+		s.Allow(msgA)
+	}
+	for i := 0; i < 2; i++ {
+		s.Allow(msgB)
+	}
+
+	// each call site gets a burst of 1, so 2 of 3 at A and 1 of 2 at B
+	// are dropped.
+	if dropped := s.Dropped(); dropped != 3 {
+		t.Errorf("expected Dropped() == 3, got %d", dropped)
+	}
+}